@@ -1,6 +1,7 @@
 package base
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -14,12 +15,22 @@ import (
 	"github.com/kballard/go-shellquote"
 	"github.com/keybase/go-keybase-chat-bot/kbchat"
 	"github.com/keybase/go-keybase-chat-bot/kbchat/types/chat1"
+	"github.com/keybase/go-keybase-chat-bot/kbchat/types/stellar1"
 	"golang.org/x/sync/errgroup"
 )
 
 type Handler interface {
 	HandleCommand(chat1.MsgSummary) error
 	HandleNewConv(chat1.ConvSummary) error
+	HandleWalletEvent(stellar1.PaymentDetailsLocal) error
+}
+
+// WalletUnsupported can be embedded into a Handler that has no use for
+// wallet/Stellar payment events, satisfying the interface with a no-op.
+type WalletUnsupported struct{}
+
+func (w WalletUnsupported) HandleWalletEvent(payment stellar1.PaymentDetailsLocal) error {
+	return nil
 }
 
 type Shutdowner interface {
@@ -36,14 +47,31 @@ type Server struct {
 	awsOpts      *AWSOptions
 	kbc          *kbchat.API
 	botAdmins    []string
+	children     *childRegistry
+	logSinks     []LogSink
+
+	subs             *subHolder
+	healthzStaleness time.Duration
+	readErrors       int64
+	reconnects       int64
+	lastReadAt       int64
+	startedAt        int64
 }
 
-func NewServer(announcement string, awsOpts *AWSOptions) *Server {
+// NewServer constructs a Server. sinks are consulted, in order, by the
+// !botlog admin command; if none are given but awsOpts is set, a single
+// CloudWatchLogSink is used so existing callers keep working unchanged.
+func NewServer(announcement string, awsOpts *AWSOptions, sinks ...LogSink) *Server {
+	if len(sinks) == 0 && awsOpts != nil {
+		sinks = []LogSink{NewCloudWatchLogSink(awsOpts.AWSRegion, awsOpts.CloudWatchLogGroup)}
+	}
 	return &Server{
 		announcement: announcement,
 		awsOpts:      awsOpts,
 		botAdmins:    DefaultBotAdmins,
 		shutdownCh:   make(chan struct{}),
+		children:     newChildRegistry(),
+		logSinks:     sinks,
 	}
 }
 
@@ -88,6 +116,7 @@ func (s *Server) Start(keybaseLoc, home string) (kbc *kbchat.API, err error) {
 		return s.kbc, err
 	}
 	s.DebugOutput = NewDebugOutput("Server", s.kbc)
+	go s.reapChildren(s.shutdownCh)
 	return s.kbc, nil
 }
 
@@ -116,15 +145,18 @@ func (s *Server) SendAnnouncement(announcement, running string) (err error) {
 }
 
 func (s *Server) Listen(handler Handler) error {
-	sub, err := s.kbc.Listen(kbchat.ListenOptions{Convs: true})
+	sub, err := s.kbc.Listen(kbchat.ListenOptions{Convs: true, Wallet: true})
 	if err != nil {
 		s.Debug("Listen: failed to listen: %s", err)
 		return err
 	}
-	s.Debug("startup success, listening for messages and convs...")
+	s.subs = &subHolder{sub: sub}
+	s.markStarted()
+	s.Debug("startup success, listening for messages, convs and wallet events...")
 	var eg errgroup.Group
-	eg.Go(func() error { return s.listenForMsgs(s.shutdownCh, sub, handler) })
-	eg.Go(func() error { return s.listenForConvs(s.shutdownCh, sub, handler) })
+	eg.Go(func() error { return s.listenForMsgs(s.shutdownCh, handler) })
+	eg.Go(func() error { return s.listenForConvs(s.shutdownCh, handler) })
+	eg.Go(func() error { return s.listenForWallet(s.shutdownCh, handler) })
 	if err := eg.Wait(); err != nil {
 		s.Debug("wait error: %s", err)
 		return err
@@ -133,7 +165,8 @@ func (s *Server) Listen(handler Handler) error {
 	return nil
 }
 
-func (s *Server) listenForMsgs(shutdownCh chan struct{}, sub *kbchat.NewSubscription, handler Handler) error {
+func (s *Server) listenForMsgs(shutdownCh chan struct{}, handler Handler) error {
+	var consecutiveErrors int
 	for {
 		select {
 		case <-shutdownCh:
@@ -142,11 +175,24 @@ func (s *Server) listenForMsgs(shutdownCh chan struct{}, sub *kbchat.NewSubscrip
 		default:
 		}
 
+		sub := s.subs.get()
 		m, err := sub.Read()
 		if err != nil {
 			s.Debug("listenForMsgs: Read() error: %s", err)
+			s.addReadError()
+			consecutiveErrors++
+			if consecutiveErrors >= maxConsecutiveReadErrors {
+				if err := s.reconnect(sub); err != nil {
+					s.Debug("listenForMsgs: unable to reconnect: %s", err)
+				} else {
+					consecutiveErrors = 0
+				}
+			}
+			time.Sleep(readBackoff(consecutiveErrors))
 			continue
 		}
+		consecutiveErrors = 0
+		s.markRead()
 
 		msg := m.Message
 		if msg.Content.Text != nil {
@@ -176,7 +222,8 @@ func (s *Server) listenForMsgs(shutdownCh chan struct{}, sub *kbchat.NewSubscrip
 	}
 }
 
-func (s *Server) listenForConvs(shutdownCh chan struct{}, sub *kbchat.NewSubscription, handler Handler) error {
+func (s *Server) listenForConvs(shutdownCh chan struct{}, handler Handler) error {
+	var consecutiveErrors int
 	for {
 		select {
 		case <-shutdownCh:
@@ -185,11 +232,24 @@ func (s *Server) listenForConvs(shutdownCh chan struct{}, sub *kbchat.NewSubscri
 		default:
 		}
 
+		sub := s.subs.get()
 		c, err := sub.ReadNewConvs()
 		if err != nil {
 			s.Debug("listenForConvs: ReadNewConvs() error: %s", err)
+			s.addReadError()
+			consecutiveErrors++
+			if consecutiveErrors >= maxConsecutiveReadErrors {
+				if err := s.reconnect(sub); err != nil {
+					s.Debug("listenForConvs: unable to reconnect: %s", err)
+				} else {
+					consecutiveErrors = 0
+				}
+			}
+			time.Sleep(readBackoff(consecutiveErrors))
 			continue
 		}
+		consecutiveErrors = 0
+		s.markRead()
 
 		if err := handler.HandleNewConv(c.Conversation); err != nil {
 			s.Debug("listenForConvs: unable to HandleNewConv: %v", err)
@@ -197,6 +257,41 @@ func (s *Server) listenForConvs(shutdownCh chan struct{}, sub *kbchat.NewSubscri
 	}
 }
 
+func (s *Server) listenForWallet(shutdownCh chan struct{}, handler Handler) error {
+	var consecutiveErrors int
+	for {
+		select {
+		case <-shutdownCh:
+			s.Debug("listenForWallet: shutting down")
+			return nil
+		default:
+		}
+
+		sub := s.subs.get()
+		event, err := sub.ReadWalletEvent()
+		if err != nil {
+			s.Debug("listenForWallet: ReadWalletEvent() error: %s", err)
+			s.addReadError()
+			consecutiveErrors++
+			if consecutiveErrors >= maxConsecutiveReadErrors {
+				if err := s.reconnect(sub); err != nil {
+					s.Debug("listenForWallet: unable to reconnect: %s", err)
+				} else {
+					consecutiveErrors = 0
+				}
+			}
+			time.Sleep(readBackoff(consecutiveErrors))
+			continue
+		}
+		consecutiveErrors = 0
+		s.markRead()
+
+		if err := handler.HandleWalletEvent(event.Payment); err != nil {
+			s.Debug("listenForWallet: unable to HandleWalletEvent: %v", err)
+		}
+	}
+}
+
 func (s *Server) allowHiddenCommand(msg chat1.MsgSummary) bool {
 	for _, username := range s.botAdmins {
 		if username == msg.Sender.Username {
@@ -268,17 +363,32 @@ func (s *Server) handlePProf(msg chat1.MsgSummary) error {
 
 	s.ChatEcho(msg.ConvID, "starting pprof... %s", toks)
 	cmd := s.kbc.Command(toks...)
-	if err := cmd.Run(); err != nil {
-		s.ChatDebugFull(msg.ConvID, "unable to get run command: %v", err)
+	pid, done, err := s.children.registerStarting(func() (int, error) {
+		if err := cmd.Start(); err != nil {
+			return 0, err
+		}
+		return cmd.Process.Pid, nil
+	})
+	if err != nil {
+		s.ChatDebugFull(msg.ConvID, "unable to start command: %v", err)
 		return err
 	}
 	go func() {
-		time.Sleep(dur + time.Second)
+		select {
+		case wstatus := <-done:
+			if !wstatus.Exited() || wstatus.ExitStatus() != 0 {
+				s.Debug("pprof process %d exited abnormally: %+v", pid, wstatus)
+				return
+			}
+		case <-time.After(dur + time.Minute):
+			s.Debug("timed out waiting for pprof process %d to exit", pid)
+			return
+		}
 		defer func() {
 			// Cleanup after the file is sent.
 			time.Sleep(time.Minute)
 			s.Debug("cleaning up %s", outfile)
-			if err = os.Remove(outfile); err != nil {
+			if err := os.Remove(outfile); err != nil {
 				s.Debug("unable to clean up %s: %v", outfile, err)
 			}
 		}()
@@ -296,15 +406,10 @@ func (s *Server) handleBotLogs(msg chat1.MsgSummary) error {
 		return nil
 	}
 
-	if s.awsOpts == nil {
-		return fmt.Errorf("AWS not properly configured")
+	if len(s.logSinks) == 0 {
+		return fmt.Errorf("no log sinks configured")
 	}
 
-	s.ChatEcho(msg.ConvID, "fetching logs from cloud watch")
-	logs, err := GetLatestCloudwatchLogs(s.awsOpts.AWSRegion, s.awsOpts.CloudWatchLogGroup)
-	if err != nil {
-		return err
-	}
 	tld := "private"
 	if msg.Channel.MembersType == "team" {
 		tld = "team"
@@ -314,16 +419,26 @@ func (s *Server) handleBotLogs(msg chat1.MsgSummary) error {
 	if err := exec.Command("keybase", "fs", "mkdir", folder).Run(); err != nil {
 		return fmt.Errorf("kbfsOutput: failed to make directory: %s", err)
 	}
-	fileName := fmt.Sprintf("botlogs-%d.txt", time.Now().Unix())
-	filePath := fmt.Sprintf("/tmp/%s", fileName)
-	defer os.Remove(filePath)
-	if err := ioutil.WriteFile(filePath, []byte(strings.Join(logs, "\n")), 0644); err != nil {
-		return fmt.Errorf("kbfsOutput: failed to write log output: %s", err)
-	}
-	if err := exec.Command("keybase", "fs", "mv", filePath, folder).Run(); err != nil {
-		return fmt.Errorf("kbfsOutput: failed to move log output: %s", err)
+
+	for _, sink := range s.logSinks {
+		s.ChatEcho(msg.ConvID, "fetching logs from %s", sink.Name())
+		logs, err := sink.FetchLatest(context.Background(), 0)
+		if err != nil {
+			s.ChatDebugFull(msg.ConvID, "unable to fetch logs from %s: %v", sink.Name(), err)
+			continue
+		}
+
+		fileName := fmt.Sprintf("%s-%d.txt", sink.Name(), time.Now().Unix())
+		filePath := fmt.Sprintf("/tmp/%s", fileName)
+		if err := ioutil.WriteFile(filePath, []byte(strings.Join(logs, "\n")), 0644); err != nil {
+			return fmt.Errorf("kbfsOutput: failed to write log output: %s", err)
+		}
+		if err := exec.Command("keybase", "fs", "mv", filePath, folder).Run(); err != nil {
+			os.Remove(filePath)
+			return fmt.Errorf("kbfsOutput: failed to move log output: %s", err)
+		}
+		destFilePath := fmt.Sprintf("%s/%s", folder, fileName)
+		s.ChatEcho(msg.ConvID, "log output: %s", destFilePath)
 	}
-	destFilePath := fmt.Sprintf("%s/%s", folder, fileName)
-	s.ChatEcho(msg.ConvID, "log output: %s", destFilePath)
 	return nil
 }
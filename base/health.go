@@ -0,0 +1,92 @@
+package base
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHealthzStaleness is how long Healthz tolerates going without a
+// successful read before reporting the bot unhealthy.
+const DefaultHealthzStaleness = 5 * time.Minute
+
+// SetHealthzStaleness overrides the staleness threshold used by Healthz.
+func (s *Server) SetHealthzStaleness(d time.Duration) {
+	s.healthzStaleness = d
+}
+
+func (s *Server) addReadError() {
+	atomic.AddInt64(&s.readErrors, 1)
+}
+
+func (s *Server) addReconnect() {
+	atomic.AddInt64(&s.reconnects, 1)
+}
+
+func (s *Server) markRead() {
+	atomic.StoreInt64(&s.lastReadAt, time.Now().UnixNano())
+}
+
+// markStarted records when the listen loops came up, so Healthz has a
+// reference point even before the first successful read.
+func (s *Server) markStarted() {
+	atomic.StoreInt64(&s.startedAt, time.Now().UnixNano())
+}
+
+// StartedAt is when Listen began serving, or the zero Time if Listen
+// hasn't been called yet.
+func (s *Server) StartedAt() time.Time {
+	nanos := atomic.LoadInt64(&s.startedAt)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// ReadErrors is the total number of sub.Read() / sub.ReadNewConvs() /
+// sub.ReadWalletEvent() errors seen since startup.
+func (s *Server) ReadErrors() int64 {
+	return atomic.LoadInt64(&s.readErrors)
+}
+
+// Reconnects is the number of times the listen loops have had to
+// re-subscribe after too many consecutive read errors.
+func (s *Server) Reconnects() int64 {
+	return atomic.LoadInt64(&s.reconnects)
+}
+
+// LastReadAt is the time of the most recent successful read across all
+// listen loops. The zero Time means nothing has been read yet.
+func (s *Server) LastReadAt() time.Time {
+	nanos := atomic.LoadInt64(&s.lastReadAt)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Healthz reports an error if the bot hasn't successfully read a message,
+// conversation or wallet event recently enough, which usually means the
+// underlying `keybase chat api-listen` process has died. Staleness is
+// measured from the most recent successful read, or from startup if there
+// hasn't been one yet, so a listener that never manages a single read is
+// eventually reported unhealthy instead of healthy forever. Wire it up to
+// a /healthz endpoint or a watchdog for long-running bots.
+func (s *Server) Healthz() error {
+	reference := s.StartedAt()
+	if lastReadAt := s.LastReadAt(); lastReadAt.After(reference) {
+		reference = lastReadAt
+	}
+	if reference.IsZero() {
+		// Listen hasn't started yet.
+		return nil
+	}
+	staleness := s.healthzStaleness
+	if staleness == 0 {
+		staleness = DefaultHealthzStaleness
+	}
+	if since := time.Since(reference); since > staleness {
+		return fmt.Errorf("no successful read in %s (last at %s)", since.Round(time.Second), reference)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package base
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthzBeforeListenStarts(t *testing.T) {
+	s := NewServer("", nil)
+	if err := s.Healthz(); err != nil {
+		t.Fatalf("Healthz() before Listen = %v, want nil", err)
+	}
+}
+
+func TestHealthzStaleWithoutAnyRead(t *testing.T) {
+	s := NewServer("", nil)
+	s.SetHealthzStaleness(time.Minute)
+	atomic.StoreInt64(&s.startedAt, time.Now().Add(-time.Hour).UnixNano())
+
+	if err := s.Healthz(); err == nil {
+		t.Fatal("Healthz() = nil, want error for a listener that has never completed a read")
+	}
+}
+
+func TestHealthzFreshRead(t *testing.T) {
+	s := NewServer("", nil)
+	s.SetHealthzStaleness(time.Minute)
+	atomic.StoreInt64(&s.startedAt, time.Now().Add(-time.Hour).UnixNano())
+	s.markRead()
+
+	if err := s.Healthz(); err != nil {
+		t.Fatalf("Healthz() = %v, want nil right after a read", err)
+	}
+}
+
+func TestHealthzStaleRead(t *testing.T) {
+	s := NewServer("", nil)
+	s.SetHealthzStaleness(time.Minute)
+	atomic.StoreInt64(&s.startedAt, time.Now().Add(-time.Hour).UnixNano())
+	atomic.StoreInt64(&s.lastReadAt, time.Now().Add(-time.Hour).UnixNano())
+
+	if err := s.Healthz(); err == nil {
+		t.Fatal("Healthz() = nil, want error for a stale last read")
+	}
+}
@@ -0,0 +1,174 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogSink is a source of recent log lines that the !botlog admin command
+// can fetch and ship to KBFS. Implementations wrap whatever the deployment
+// actually logs to (CloudWatch, a rotating file, journald, ...).
+type LogSink interface {
+	// FetchLatest returns up to limit of the most recent log lines, oldest
+	// first. A limit of 0 means "no limit".
+	FetchLatest(ctx context.Context, limit int) ([]string, error)
+	// Name identifies the sink, used to name the uploaded KBFS file.
+	Name() string
+}
+
+func tailLines(lines []string, limit int) []string {
+	if limit > 0 && len(lines) > limit {
+		return lines[len(lines)-limit:]
+	}
+	return lines
+}
+
+func splitLogLines(raw []byte) []string {
+	trimmed := strings.TrimRight(string(raw), "\n")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "\n")
+}
+
+// CloudWatchLogSink reads from a CloudWatch log group. This is the original
+// (and, until now, only) way !botlog fetched its logs.
+type CloudWatchLogSink struct {
+	region   string
+	logGroup string
+}
+
+func NewCloudWatchLogSink(region, logGroup string) *CloudWatchLogSink {
+	return &CloudWatchLogSink{region: region, logGroup: logGroup}
+}
+
+func (s *CloudWatchLogSink) Name() string { return "cloudwatch" }
+
+func (s *CloudWatchLogSink) FetchLatest(ctx context.Context, limit int) ([]string, error) {
+	logs, err := GetLatestCloudwatchLogs(s.region, s.logGroup)
+	if err != nil {
+		return nil, err
+	}
+	return tailLines(logs, limit), nil
+}
+
+// FileLogSink reads from a lumberjack-rotated log file on disk: the active
+// file plus whatever backups lumberjack has kept around, oldest first.
+type FileLogSink struct {
+	Logger *lumberjack.Logger
+}
+
+// NewFileLogSink configures a rotating log file. maxSizeMB, maxAgeDays and
+// maxBackups follow lumberjack's own semantics: 0 means "no limit" for
+// maxAgeDays and maxBackups, and lumberjack's 100 MB default for maxSizeMB.
+func NewFileLogSink(filename string, maxSizeMB, maxAgeDays, maxBackups int) *FileLogSink {
+	return &FileLogSink{
+		Logger: &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    maxSizeMB,
+			MaxAge:     maxAgeDays,
+			MaxBackups: maxBackups,
+		},
+	}
+}
+
+func (s *FileLogSink) Name() string { return "file" }
+
+func (s *FileLogSink) FetchLatest(ctx context.Context, limit int) ([]string, error) {
+	// lumberjack names rotated backups "<prefix>-<timestamp><ext>", with the
+	// timestamp inserted before the extension rather than appended after
+	// the whole filename.
+	dir := filepath.Dir(s.Logger.Filename)
+	base := filepath.Base(s.Logger.Filename)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+
+	backups, err := filepath.Glob(filepath.Join(dir, prefix+"-*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(backups)
+	files := append(backups, s.Logger.Filename)
+
+	var lines []string
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, splitLogLines(raw)...)
+	}
+	return tailLines(lines, limit), nil
+}
+
+// JournaldLogSink reads from journald via journalctl, optionally scoped to a
+// single systemd unit.
+type JournaldLogSink struct {
+	unit string
+}
+
+func NewJournaldLogSink(unit string) *JournaldLogSink {
+	return &JournaldLogSink{unit: unit}
+}
+
+func (s *JournaldLogSink) Name() string { return "journald" }
+
+func (s *JournaldLogSink) FetchLatest(ctx context.Context, limit int) ([]string, error) {
+	args := []string{"--no-pager", "-o", "short-iso"}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	if s.unit != "" {
+		args = append(args, "-u", s.unit)
+	}
+	out, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("journalctl: %s", err)
+	}
+	return splitLogLines(out), nil
+}
+
+// StdoutLogSink is an in-memory ring buffer that can be plugged in as an
+// io.Writer (e.g. alongside log.SetOutput) to make !botlog useful in local
+// dev, where there's no CloudWatch, file or journald to read from.
+type StdoutLogSink struct {
+	mu    sync.Mutex
+	lines []string
+	max   int
+}
+
+func NewStdoutLogSink(max int) *StdoutLogSink {
+	return &StdoutLogSink{max: max}
+}
+
+func (s *StdoutLogSink) Name() string { return "stdout" }
+
+func (s *StdoutLogSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range splitLogLines(p) {
+		s.lines = append(s.lines, line)
+	}
+	if len(s.lines) > s.max {
+		s.lines = s.lines[len(s.lines)-s.max:]
+	}
+	return len(p), nil
+}
+
+func (s *StdoutLogSink) FetchLatest(ctx context.Context, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := tailLines(s.lines, limit)
+	out := make([]string, len(lines))
+	copy(out, lines)
+	return out, nil
+}
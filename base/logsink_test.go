@@ -0,0 +1,106 @@
+package base
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSplitLogLines(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"\n", nil},
+		{"one", []string{"one"}},
+		{"one\ntwo\n", []string{"one", "two"}},
+		{"one\ntwo", []string{"one", "two"}},
+	}
+	for _, c := range cases {
+		if got := splitLogLines([]byte(c.in)); !equalStrings(got, c.want) {
+			t.Errorf("splitLogLines(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	lines := []string{"a", "b", "c", "d"}
+	if got := tailLines(lines, 0); !equalStrings(got, lines) {
+		t.Errorf("tailLines(lines, 0) = %v, want all lines", got)
+	}
+	if got := tailLines(lines, 2); !equalStrings(got, []string{"c", "d"}) {
+		t.Errorf("tailLines(lines, 2) = %v, want [c d]", got)
+	}
+	if got := tailLines(lines, 10); !equalStrings(got, lines) {
+		t.Errorf("tailLines(lines, 10) = %v, want all lines", got)
+	}
+}
+
+func TestFileLogSinkFetchLatest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	active := filepath.Join(dir, "bot.log")
+	// Matches the filename lumberjack actually produces for rotated
+	// backups: "<prefix>-<timestamp><ext>".
+	backup := filepath.Join(dir, "bot-2024-01-01T00-00-00.000.log")
+	if err := ioutil.WriteFile(backup, []byte("old1\nold2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(active, []byte("new1\nnew2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewFileLogSink(active, 10, 7, 3)
+	lines, err := sink.FetchLatest(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"old1", "old2", "new1", "new2"}
+	if !equalStrings(lines, want) {
+		t.Fatalf("FetchLatest() = %v, want %v", lines, want)
+	}
+	if name := sink.Name(); name != "file" {
+		t.Errorf("Name() = %q, want %q", name, "file")
+	}
+}
+
+func TestFileLogSinkFetchLatestLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	active := filepath.Join(dir, "bot.log")
+	if err := ioutil.WriteFile(active, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewFileLogSink(active, 10, 7, 3)
+	lines, err := sink.FetchLatest(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"two", "three"}; !equalStrings(lines, want) {
+		t.Fatalf("FetchLatest(limit=2) = %v, want %v", lines, want)
+	}
+}
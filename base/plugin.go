@@ -0,0 +1,288 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package base
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/keybase/go-keybase-chat-bot/kbchat"
+	"github.com/keybase/go-keybase-chat-bot/kbchat/types/chat1"
+)
+
+// pluginScanInterval is how often PluginHandler rescans its directory for
+// new or changed *.so files.
+const pluginScanInterval = 5 * time.Second
+
+// PluginCommand is the interface a hot-reloadable command plugin must
+// expose as a package-level `var Command base.PluginCommand`.
+type PluginCommand interface {
+	Name() string
+	Match(chat1.MsgSummary) bool
+	Run(*kbchat.API, chat1.MsgSummary) error
+	Shutdown() error
+}
+
+// loadedPlugin's mu guards against Shutdown being called on a plugin that's
+// still mid-Run: load() takes the write lock before shutting an old
+// instance down, while HandleCommand holds the read lock for the duration
+// of Run. loadPath is the scratch copy actually passed to plugin.Open (see
+// load), kept around so it can be cleaned up once superseded.
+type loadedPlugin struct {
+	modTime  time.Time
+	cmd      PluginCommand
+	loadPath string
+	mu       sync.RWMutex
+}
+
+// PluginHandler wraps a Handler and layers hot-reloadable commands on top
+// of it: it periodically scans dir for *.so files built with `go build
+// -buildmode=plugin`, loads (or reloads) any that are new or have changed,
+// and tries each loaded plugin's Match before falling back to the wrapped
+// Handler. This lets the shared bot process pick up new commands without a
+// rebuild or restart.
+type PluginHandler struct {
+	Handler
+
+	kbc        *kbchat.API
+	dir        string
+	adminConv  string
+	scratchDir string
+	stopCh     chan struct{}
+
+	mu      sync.Mutex
+	plugins map[string]*loadedPlugin
+	failed  map[string]time.Time
+}
+
+// NewPluginHandler wraps handler with plugin support, watching dir for
+// *.so files. Every load/unload is announced to adminConv (a conv ID) for
+// auditability; pass "" to disable the announcements.
+func NewPluginHandler(handler Handler, kbc *kbchat.API, dir, adminConv string) *PluginHandler {
+	scratchDir, err := ioutil.TempDir("", "managed-bots-plugins")
+	if err != nil {
+		// Fall back to a scratch dir alongside the plugins themselves
+		// rather than failing construction outright.
+		scratchDir = filepath.Join(dir, ".loaded")
+		os.MkdirAll(scratchDir, 0700)
+	}
+	h := &PluginHandler{
+		Handler:    handler,
+		kbc:        kbc,
+		dir:        dir,
+		adminConv:  adminConv,
+		scratchDir: scratchDir,
+		stopCh:     make(chan struct{}),
+		plugins:    make(map[string]*loadedPlugin),
+		failed:     make(map[string]time.Time),
+	}
+	go h.watch()
+	return h
+}
+
+// Shutdown stops watching dir, shuts down every loaded plugin, and removes
+// the scratch copies made for plugin.Open.
+func (h *PluginHandler) Shutdown() error {
+	close(h.stopCh)
+	h.mu.Lock()
+	plugins := h.plugins
+	h.plugins = make(map[string]*loadedPlugin)
+	h.mu.Unlock()
+
+	for path, p := range plugins {
+		p.mu.Lock()
+		name := p.cmd.Name()
+		err := p.cmd.Shutdown()
+		p.mu.Unlock()
+		if err != nil {
+			h.logf("plugin unload: %s: %v", path, err)
+		} else {
+			h.logf("unloaded plugin %q from %s", name, path)
+		}
+	}
+	os.RemoveAll(h.scratchDir)
+	return nil
+}
+
+func (h *PluginHandler) watch() {
+	h.scan()
+	ticker := time.NewTicker(pluginScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stopCh:
+			return
+		case <-ticker.C:
+			h.scan()
+		}
+	}
+}
+
+func (h *PluginHandler) scan() {
+	entries, err := ioutil.ReadDir(h.dir)
+	if err != nil {
+		h.logf("plugin scan: unable to read %s: %v", h.dir, err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".so") {
+			continue
+		}
+		path := filepath.Join(h.dir, entry.Name())
+
+		h.mu.Lock()
+		existing, loaded := h.plugins[path]
+		failedModTime, failedBefore := h.failed[path]
+		h.mu.Unlock()
+		if loaded && !entry.ModTime().After(existing.modTime) {
+			continue
+		}
+		if failedBefore && !entry.ModTime().After(failedModTime) {
+			// Already tried and failed on this exact version of the file;
+			// don't retry (and re-announce the failure) every tick.
+			continue
+		}
+
+		if err := h.load(path, entry.ModTime()); err != nil {
+			h.mu.Lock()
+			h.failed[path] = entry.ModTime()
+			h.mu.Unlock()
+			h.logf("plugin load: %s: %v", path, err)
+			continue
+		}
+		h.mu.Lock()
+		delete(h.failed, path)
+		h.mu.Unlock()
+	}
+}
+
+func (h *PluginHandler) load(path string, modTime time.Time) error {
+	if err := verifyOwnedByBotUser(path); err != nil {
+		return err
+	}
+
+	// plugin.Open caches by path: reopening the same path after an
+	// in-place rebuild hands back the stale, already-loaded code instead
+	// of actually reloading it. Open a per-mtime scratch copy instead so
+	// every distinct version of path is opened under a new path. The Go
+	// runtime still refuses a plugin whose plugin path matches one already
+	// loaded: a plugin built from a package import path keeps that path
+	// across rebuilds, so its new version fails with "plugin already
+	// loaded" and the old instance stays registered. Plugins built from
+	// file arguments get a content-derived plugin path and do reload.
+	loadPath, err := h.copyForLoad(path, modTime)
+	if err != nil {
+		return fmt.Errorf("copying plugin to scratch dir: %s", err)
+	}
+
+	p, err := plugin.Open(loadPath)
+	if err != nil {
+		return fmt.Errorf("plugin.Open: %s", err)
+	}
+	sym, err := p.Lookup("Command")
+	if err != nil {
+		return fmt.Errorf("missing Command symbol: %s", err)
+	}
+	cmdPtr, ok := sym.(*PluginCommand)
+	if !ok {
+		return fmt.Errorf("Command symbol has unexpected type %T, want base.PluginCommand", sym)
+	}
+	cmd := *cmdPtr
+
+	h.mu.Lock()
+	old, hadOld := h.plugins[path]
+	h.plugins[path] = &loadedPlugin{modTime: modTime, cmd: cmd, loadPath: loadPath}
+	h.mu.Unlock()
+
+	if hadOld {
+		// Wait for any in-flight Run on the old instance to finish before
+		// shutting it down.
+		old.mu.Lock()
+		name := old.cmd.Name()
+		err := old.cmd.Shutdown()
+		old.mu.Unlock()
+		if err != nil {
+			h.logf("plugin unload: %s: %v", path, err)
+		} else {
+			h.logf("unloaded plugin %q from %s", name, path)
+		}
+		os.Remove(old.loadPath)
+	}
+	h.logf("loaded plugin %q from %s", cmd.Name(), path)
+	return nil
+}
+
+// copyForLoad copies path into h.scratchDir under a name unique to modTime
+// and returns that copy's path, so plugin.Open sees a path it has never
+// opened before.
+func (h *PluginHandler) copyForLoad(path string, modTime time.Time) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	loadPath := filepath.Join(h.scratchDir, fmt.Sprintf("%s-%d.so", filepath.Base(path), modTime.UnixNano()))
+	if err := ioutil.WriteFile(loadPath, data, 0500); err != nil {
+		return "", err
+	}
+	return loadPath, nil
+}
+
+// verifyOwnedByBotUser refuses to load a plugin that isn't owned by the
+// user the bot itself is running as, so a compromised or shared directory
+// can't be used to get arbitrary code loaded into the bot process.
+func verifyOwnedByBotUser(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("%s: unable to determine file owner", path)
+	}
+	if uid := os.Getuid(); int(stat.Uid) != uid {
+		return fmt.Errorf("%s: refusing to load, owned by uid %d, bot runs as uid %d", path, stat.Uid, uid)
+	}
+	return nil
+}
+
+func (h *PluginHandler) logf(format string, args ...interface{}) {
+	if h.adminConv == "" {
+		return
+	}
+	if _, err := h.kbc.SendMessageByConvID(chat1.ConvIDStr(h.adminConv), fmt.Sprintf(format, args...)); err != nil {
+		return
+	}
+}
+
+// HandleCommand dispatches to a loaded plugin whose Match returns true,
+// falling back to the wrapped Handler if none match. Plugins are tried in
+// no defined order, so if several match, which one runs is not defined.
+func (h *PluginHandler) HandleCommand(msg chat1.MsgSummary) error {
+	h.mu.Lock()
+	plugins := make([]*loadedPlugin, 0, len(h.plugins))
+	for _, p := range h.plugins {
+		plugins = append(plugins, p)
+	}
+	h.mu.Unlock()
+
+	for _, p := range plugins {
+		p.mu.RLock()
+		matched := p.cmd.Match(msg)
+		if !matched {
+			p.mu.RUnlock()
+			continue
+		}
+		err := p.cmd.Run(h.kbc, msg)
+		p.mu.RUnlock()
+		return err
+	}
+	return h.Handler.HandleCommand(msg)
+}
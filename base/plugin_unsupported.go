@@ -0,0 +1,34 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package base
+
+import (
+	"github.com/keybase/go-keybase-chat-bot/kbchat"
+	"github.com/keybase/go-keybase-chat-bot/kbchat/types/chat1"
+)
+
+// PluginCommand mirrors the linux/darwin definition so callers can type
+// plugins portably even though loading them isn't supported here.
+type PluginCommand interface {
+	Name() string
+	Match(chat1.MsgSummary) bool
+	Run(*kbchat.API, chat1.MsgSummary) error
+	Shutdown() error
+}
+
+// PluginHandler is a pass-through on platforms without support for Go's
+// plugin package (anything but linux and darwin); it never loads anything
+// from dir.
+type PluginHandler struct {
+	Handler
+}
+
+// NewPluginHandler returns handler wrapped unchanged; dir and adminConv are
+// accepted for signature compatibility but otherwise ignored, since Go's
+// plugin package isn't available on this platform.
+func NewPluginHandler(handler Handler, kbc *kbchat.API, dir, adminConv string) *PluginHandler {
+	return &PluginHandler{Handler: handler}
+}
+
+func (h *PluginHandler) Shutdown() error { return nil }
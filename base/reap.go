@@ -0,0 +1,62 @@
+package base
+
+import "sync"
+
+// childRegistry tracks processes explicitly opted in for reaping via
+// reapChildren (currently just !pprof), so that callers can await their
+// exit instead of guessing with time.Sleep. Children started elsewhere
+// (e.g. handleLogSend's and handleBotLogs's exec.Command/cmd.Wait calls)
+// are deliberately never registered here: reapChildren only ever waits on
+// registered pids, leaving every other child to be reaped by os/exec's own
+// Wait/Run as usual.
+type childRegistry struct {
+	sync.Mutex
+	waiters map[int]chan WaitStatus
+}
+
+func newChildRegistry() *childRegistry {
+	return &childRegistry{
+		waiters: make(map[int]chan WaitStatus),
+	}
+}
+
+// registerStarting runs start (which must start a child process and return
+// its pid) while holding the registry lock, and registers a waiter for the
+// returned pid before releasing it. This closes the gap between a child
+// starting and reapChildren being able to observe its exit: since
+// reapChildren also takes the registry lock to snapshot which pids to wait
+// on, it can never see this pid before the waiter for it exists.
+func (r *childRegistry) registerStarting(start func() (int, error)) (int, <-chan WaitStatus, error) {
+	r.Lock()
+	defer r.Unlock()
+	pid, err := start()
+	if err != nil {
+		return 0, nil, err
+	}
+	ch := make(chan WaitStatus, 1)
+	r.waiters[pid] = ch
+	return pid, ch, nil
+}
+
+// pids returns a snapshot of the pids currently registered for reaping.
+func (r *childRegistry) pids() []int {
+	r.Lock()
+	defer r.Unlock()
+	pids := make([]int, 0, len(r.waiters))
+	for pid := range r.waiters {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+func (r *childRegistry) complete(pid int, status WaitStatus) {
+	r.Lock()
+	ch, ok := r.waiters[pid]
+	if ok {
+		delete(r.waiters, pid)
+	}
+	r.Unlock()
+	if ok {
+		ch <- status
+	}
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+// +build !windows
+
+package base
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WaitStatus is the exit status delivered to a reaped child's completion
+// channel.
+type WaitStatus = syscall.WaitStatus
+
+// reapChildren installs a SIGCHLD handler and, on every signal, drains
+// exit status for whatever pids are currently registered in
+// s.children. It deliberately waits on specific registered pids rather
+// than wait4(-1, ...): the latter would race os/exec's own Wait/Run calls
+// for children that were never registered (handleLogSend, handleBotLogs),
+// occasionally stealing their exit status out from under them and turning
+// a successful command into a spurious ECHILD error.
+//
+// shutdownCh is the channel to stop on, passed by value rather than read
+// off s.shutdownCh on every iteration: Server.Shutdown closes and nils out
+// that field under s.Lock, and a live read here (with no lock of its own)
+// would race it and could end up blocking on a nil channel forever.
+func (s *Server) reapChildren(shutdownCh chan struct{}) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGCHLD)
+	for {
+		select {
+		case <-shutdownCh:
+			return
+		case <-sigCh:
+		}
+
+		for _, pid := range s.children.pids() {
+			var wstatus syscall.WaitStatus
+			reaped, err := syscall.Wait4(pid, &wstatus, syscall.WNOHANG, nil)
+			if err != nil {
+				if err == syscall.ECHILD || err == syscall.EINTR {
+					continue
+				}
+				s.Debug("reapChildren: wait4 %d error: %s", pid, err)
+				continue
+			}
+			if reaped != pid {
+				// Not exited yet; still running.
+				continue
+			}
+			s.children.complete(pid, wstatus)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package base
+
+// WaitStatus stands in for syscall.WaitStatus, which is unavailable on
+// Windows since SIGCHLD-based reaping doesn't exist there.
+type WaitStatus struct{}
+
+func (WaitStatus) Exited() bool    { return true }
+func (WaitStatus) ExitStatus() int { return 0 }
+
+// reapChildren is a no-op on Windows; exec.Cmd reaps its own child directly
+// there, so there's no zombie-process problem to guard against.
+func (s *Server) reapChildren(shutdownCh chan struct{}) {}
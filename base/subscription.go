@@ -0,0 +1,83 @@
+package base
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/keybase/go-keybase-chat-bot/kbchat"
+)
+
+const (
+	minReadBackoff           = 100 * time.Millisecond
+	maxReadBackoff           = 30 * time.Second
+	maxConsecutiveReadErrors = 10
+)
+
+// subHolder lets listenForMsgs, listenForConvs and listenForWallet share a
+// single *kbchat.NewSubscription that any of them can swap out after a
+// reconnect, without the other two noticing anything beyond a brief gap.
+type subHolder struct {
+	mu  sync.RWMutex
+	sub *kbchat.NewSubscription
+}
+
+func (h *subHolder) get() *kbchat.NewSubscription {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sub
+}
+
+func (h *subHolder) set(sub *kbchat.NewSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sub = sub
+}
+
+// readBackoff returns how long to sleep after the given number of
+// consecutive read errors: exponential from minReadBackoff up to
+// maxReadBackoff, plus up to 50% jitter so that, e.g., all three listen
+// loops backing off together don't retry in lockstep.
+func readBackoff(consecutiveErrors int) time.Duration {
+	d := minReadBackoff
+	for i := 0; i < consecutiveErrors && d < maxReadBackoff; i++ {
+		d *= 2
+	}
+	if d > maxReadBackoff {
+		d = maxReadBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// reconnect re-establishes the subscription shared by all listen loops and
+// bumps the Reconnects counter. observedSub is whatever subscription the
+// caller was reading from when it started racking up errors: if s.subs no
+// longer holds that subscription, another listen loop has already
+// reconnected out from under it, so reconnect is a no-op and the caller
+// just adopts the already-current subscription on its next read. This
+// keeps a single connection flap from spawning up to three redundant
+// `keybase chat api-listen` subprocesses. The old subscription, if any, is
+// shut down once it's safely replaced.
+func (s *Server) reconnect(observedSub *kbchat.NewSubscription) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old := s.subs.get()
+	if old != observedSub {
+		return nil
+	}
+
+	sub, err := s.kbc.Listen(kbchat.ListenOptions{Convs: true, Wallet: true})
+	if err != nil {
+		return err
+	}
+	s.subs.set(sub)
+	s.addReconnect()
+
+	if old != nil {
+		if err := old.Shutdown(); err != nil {
+			s.Debug("reconnect: failed to shut down old subscription: %s", err)
+		}
+	}
+	return nil
+}
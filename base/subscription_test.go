@@ -0,0 +1,38 @@
+package base
+
+import "testing"
+
+func TestReadBackoffBounds(t *testing.T) {
+	for _, n := range []int{0, 1, 5, 10, 50} {
+		d := readBackoff(n)
+		if d < minReadBackoff {
+			t.Errorf("readBackoff(%d) = %s, below minimum %s", n, d, minReadBackoff)
+		}
+		if max := maxReadBackoff + maxReadBackoff/2; d > max {
+			t.Errorf("readBackoff(%d) = %s, above max+jitter %s", n, d, max)
+		}
+	}
+}
+
+func TestReadBackoffFloorGrows(t *testing.T) {
+	// Jitter means two individual samples aren't strictly ordered, but the
+	// unjittered floor readBackoff starts from should grow monotonically
+	// until it caps out at maxReadBackoff.
+	floor := minReadBackoff
+	for n := 0; n < 10; n++ {
+		if d := readBackoff(n); d < floor || d > floor+floor/2 {
+			t.Fatalf("readBackoff(%d) = %s, want within [%s, %s]", n, d, floor, floor+floor/2)
+		}
+		next := floor * 2
+		if next > maxReadBackoff || next <= 0 {
+			next = maxReadBackoff
+		}
+		if next < floor {
+			t.Fatalf("backoff floor decreased at n=%d: %s < %s", n, next, floor)
+		}
+		floor = next
+	}
+	if floor != maxReadBackoff {
+		t.Fatalf("backoff floor after 10 doublings = %s, want it capped at %s", floor, maxReadBackoff)
+	}
+}